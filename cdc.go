@@ -0,0 +1,294 @@
+package gofiledb
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event describes a single change accepted by Set/SetStruct/SetFromReader/
+// RemoveCollection/AddCollection, for consumers building derived indexes,
+// caches, or cross-process invalidation off of Client's write path.
+type Event struct {
+	Ts         time.Time
+	Collection string
+	Key        string
+	Op         walOp
+	Size       int
+}
+
+const (
+	defaultCDCFlushIntervalSec = 1
+	defaultCDCSegmentSize      = 1024
+	defaultCDCRetentionSec     = 7 * 24 * 60 * 60
+)
+
+// cdcBuffer is the in-memory ring of not-yet-flushed events plus the set of
+// live subscribers tailing it, in the spirit of SeaweedFS's
+// LocalMetaLogBuffer.
+type cdcBuffer struct {
+	dir           string
+	flushInterval time.Duration
+	segmentSize   int
+	retention     time.Duration
+	stop          chan struct{} // closed by Close to stop flushLoop
+	done          chan struct{} // closed by flushLoop once it has returned
+
+	mu          sync.Mutex
+	pending     []Event
+	subscribers map[chan Event]string // chan -> collection filter ("" means all collections)
+}
+
+func newCDCBuffer(documentRoot string, flushIntervalSec, segmentSize, retentionSec int) (*cdcBuffer, error) {
+	if flushIntervalSec <= 0 {
+		flushIntervalSec = defaultCDCFlushIntervalSec
+	}
+	if segmentSize <= 0 {
+		segmentSize = defaultCDCSegmentSize
+	}
+	if retentionSec <= 0 {
+		retentionSec = defaultCDCRetentionSec
+	}
+
+	dir := joinPath(documentRoot, META_DIR_NAME, "events")
+	if err := createDirIfNotExist(dir); err != nil {
+		return nil, err
+	}
+
+	buf := &cdcBuffer{
+		dir:           dir,
+		flushInterval: time.Duration(flushIntervalSec) * time.Second,
+		segmentSize:   segmentSize,
+		retention:     time.Duration(retentionSec) * time.Second,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		subscribers:   make(map[chan Event]string),
+	}
+	go buf.flushLoop()
+	return buf, nil
+}
+
+// append records ev, fanning it out to every live subscriber whose
+// collection filter matches before it is later flushed to disk.
+func (b *cdcBuffer) append(ev Event) {
+	b.mu.Lock()
+	b.pending = append(b.pending, ev)
+	if len(b.pending) >= b.segmentSize {
+		b.flushLocked()
+	}
+	for ch, collection := range b.subscribers {
+		if collection == "" || collection == ev.Collection {
+			select {
+			case ch <- ev:
+			default: // a slow subscriber must not block writers
+			}
+		}
+	}
+	b.mu.Unlock()
+}
+
+func (b *cdcBuffer) flushLoop() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.mu.Lock()
+			b.flushLocked()
+			b.mu.Unlock()
+			b.gc()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Close stops flushLoop and waits for it to actually return, then flushes
+// whatever is still pending so it isn't lost.
+func (b *cdcBuffer) Close() {
+	close(b.stop)
+	<-b.done
+	b.mu.Lock()
+	b.flushLocked()
+	b.mu.Unlock()
+}
+
+// flushLocked writes every pending event to a new segment file. Callers must
+// hold b.mu.
+//
+// It shares one gob.Encoder across every event in the segment rather than
+// building a fresh one per event: a fresh gob.Encoder re-sends its type
+// definition on every call, which a Decoder reading the file back (also one
+// per event, for the same reason) rejects as a duplicate type once it has
+// already seen it from an earlier event - silently losing every event past
+// the first in the segment.
+func (b *cdcBuffer) flushLocked() {
+	if len(b.pending) == 0 {
+		return
+	}
+
+	name := fmt.Sprintf("seg-%020d.gob", time.Now().UnixNano())
+	file, err := os.Create(joinPath(b.dir, name))
+	if err != nil {
+		clog.Errorf("cdc: failed to flush segment: %v", err)
+		return
+	}
+	defer file.Close()
+
+	enc := gob.NewEncoder(file)
+	for _, ev := range b.pending {
+		if err := enc.Encode(ev); err != nil {
+			clog.Errorf("cdc: failed to encode event: %v", err)
+			break
+		}
+	}
+	b.pending = b.pending[:0]
+}
+
+// gc removes segments older than the configured retention window.
+func (b *cdcBuffer) gc() {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) >= b.retention {
+			os.Remove(joinPath(b.dir, entry.Name()))
+		}
+	}
+}
+
+// replaySinceLocked reads every on-disk event for collectionName with Ts >=
+// sinceTs, oldest first. An empty collectionName matches every collection.
+// Callers must hold b.mu.
+func (b *cdcBuffer) replaySinceLocked(collectionName string, sinceTs time.Time) ([]Event, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	var events []Event
+	for _, name := range names {
+		file, err := os.Open(joinPath(b.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		// One gob.Decoder per file, reused across every event in it - see
+		// flushLocked for why a fresh one per event would drop events.
+		dec := gob.NewDecoder(file)
+		for {
+			var ev Event
+			err := dec.Decode(&ev)
+			if err != nil {
+				break
+			}
+			if !ev.Ts.Before(sinceTs) && (collectionName == "" || ev.Collection == collectionName) {
+				events = append(events, ev)
+			}
+		}
+		file.Close()
+	}
+	return events, nil
+}
+
+// subscribeAndReplay registers a live channel for collectionName and reads
+// its backlog since sinceTs as one atomic step, holding b.mu across both.
+// This closes the window append() would otherwise have to land an event
+// after replaySince reads the backlog but before subscribe registers the
+// channel - which would drop that event for good, since it is neither in the
+// backlog just read nor fanned out to a channel that does not exist yet.
+//
+// The backlog is the on-disk segments plus whatever is still sitting in
+// b.pending: pending events haven't been flushed yet, so they are absent
+// from the on-disk backlog, and registering the channel here (rather than
+// before this call) means append()'s live fan-out hasn't seen them either -
+// without folding them in here they would be lost to this subscriber for
+// good, same as the window above.
+func (b *cdcBuffer) subscribeAndReplay(collectionName string, sinceTs time.Time) (chan Event, []Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, 64)
+	b.subscribers[ch] = collectionName
+
+	backlog, err := b.replaySinceLocked(collectionName, sinceTs)
+	if err != nil {
+		delete(b.subscribers, ch)
+		return nil, nil, err
+	}
+
+	for _, ev := range b.pending {
+		if !ev.Ts.Before(sinceTs) && (collectionName == "" || ev.Collection == collectionName) {
+			backlog = append(backlog, ev)
+		}
+	}
+	return ch, backlog, nil
+}
+
+func (b *cdcBuffer) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+	close(ch)
+}
+
+// Subscribe replays every on-disk event for collectionName since sinceTs,
+// then tails the live buffer until ctx is canceled. Callers should drain the
+// returned channel promptly; a slow consumer drops live events rather than
+// stalling writers.
+func (c *Client) Subscribe(ctx context.Context, collectionName string, sinceTs time.Time) (<-chan Event, error) {
+	if c.cdc == nil {
+		return nil, fmt.Errorf("gofiledb: CDC is not enabled on this Client")
+	}
+
+	live, backlog, err := c.cdc.subscribeAndReplay(collectionName, sinceTs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan Event, len(backlog)+cap(live))
+
+	go func() {
+		defer close(out)
+		defer c.cdc.unsubscribe(live)
+
+		for _, ev := range backlog {
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for {
+			select {
+			case ev, ok := <-live:
+				if !ok {
+					return
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
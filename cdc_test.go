@@ -0,0 +1,71 @@
+package gofiledb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestCDCSegmentRoundTrip flushes several events into one segment and reads
+// them back. flushLocked/replaySinceLocked used to build a fresh gob.Encoder/
+// Decoder per event, which silently dropped every event past the first in a
+// segment once it was read back from disk.
+func TestCDCSegmentRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	buf, err := newCDCBuffer(dir, 1, 1024, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const numEvents = 5
+	for i := 0; i < numEvents; i++ {
+		buf.append(Event{Ts: time.Now(), Collection: "docs", Key: fmt.Sprintf("k%d", i), Op: walOpSet})
+	}
+
+	buf.mu.Lock()
+	buf.flushLocked()
+	events, err := buf.replaySinceLocked("", time.Time{})
+	buf.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != numEvents {
+		t.Fatalf("got %d events back, want %d", len(events), numEvents)
+	}
+}
+
+// TestSubscribeReplaysPendingEvents appends events without flushing them to
+// disk, then subscribes. subscribeAndReplay used to read only the on-disk
+// backlog, so events still sitting in b.pending at subscribe time - up to
+// flushInterval's worth - were neither in that backlog (not flushed yet) nor
+// fanned out live (they happened before the channel was registered),
+// silently dropping them for that subscriber.
+func TestSubscribeReplaysPendingEvents(t *testing.T) {
+	dir := t.TempDir()
+	// A flush interval far longer than the test keeps flushLoop from racing
+	// the assertions below by flushing b.pending out from under them.
+	buf, err := newCDCBuffer(dir, 3600, 1024, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const numEvents = 5
+	for i := 0; i < numEvents; i++ {
+		buf.append(Event{Ts: time.Now(), Collection: "docs", Key: fmt.Sprintf("k%d", i), Op: walOpSet})
+	}
+
+	ch, backlog, err := buf.subscribeAndReplay("docs", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.unsubscribe(ch)
+
+	if len(backlog) != numEvents {
+		t.Fatalf("got %d backlog events, want %d", len(backlog), numEvents)
+	}
+	for i, ev := range backlog {
+		if ev.Key != fmt.Sprintf("k%d", i) {
+			t.Fatalf("backlog[%d].Key = %q, want %q", i, ev.Key, fmt.Sprintf("k%d", i))
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package gofiledb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+)
+
+// KeyProvider hands back the 32-byte AES-256 key a collection's documents
+// should be encrypted/decrypted with.
+type KeyProvider interface {
+	// GetKey returns the 32-byte key for collectionName, and a stable
+	// identifier for that key (persisted in the collection's CipherInfo so a
+	// later key rotation can tell which key to use for old documents).
+	GetKey(collectionName string) (key []byte, keyID string, err error)
+}
+
+// CipherInfo is the per-collection cipher metadata persisted alongside the
+// IndexStore, so encrypted and plaintext collections can coexist in one
+// documentRoot.
+type CipherInfo struct {
+	Algorithm string
+	NonceSize int
+	KeyID     string
+}
+
+const cipherAlgorithmAESGCM = "AES-256-GCM"
+
+// collectionCipher wraps the AEAD a Collection encrypts/decrypts documents
+// with, built from the KeyProvider's key for that collection.
+type collectionCipher struct {
+	aead CipherInfo
+	gcm  cipher.AEAD
+}
+
+func newCollectionCipher(keys KeyProvider, collectionName string) (*collectionCipher, error) {
+	key, keyID, err := keys.GetKey(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("gofiledb: KeyProvider returned a %d byte key for %s, want 32", len(key), collectionName)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &collectionCipher{
+		aead: CipherInfo{Algorithm: cipherAlgorithmAESGCM, NonceSize: gcm.NonceSize(), KeyID: keyID},
+		gcm:  gcm,
+	}, nil
+}
+
+// seal reads all of plaintext and returns a random-nonce-prefixed
+// ciphertext ready to hand to a Store.
+func (cc *collectionCipher) seal(plaintext io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, cc.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ciphertext := cc.gcm.Seal(nil, nonce, data, nil)
+	return bytes.NewReader(append(nonce, ciphertext...)), nil
+}
+
+// open reverses seal: it strips the nonce header and decrypts the rest.
+func (cc *collectionCipher) open(ciphertext io.Reader) (io.ReadCloser, error) {
+	data, err := io.ReadAll(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := cc.gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("gofiledb: ciphertext shorter than nonce header")
+	}
+	nonce, sealed := data[:nonceSize], data[nonceSize:]
+
+	plaintext, err := cc.gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(plaintext)), nil
+}
+
+/*** KeyProvider implementations ***/
+
+// EnvKeyProvider resolves each collection's key from an environment
+// variable named prefix+collectionName, expecting exactly 32 raw bytes.
+type EnvKeyProvider struct {
+	Prefix string
+}
+
+func (p EnvKeyProvider) GetKey(collectionName string) ([]byte, string, error) {
+	varName := p.Prefix + collectionName
+	key := os.Getenv(varName)
+	if key == "" {
+		return nil, "", fmt.Errorf("gofiledb: env var %s is not set", varName)
+	}
+	return []byte(key), varName, nil
+}
+
+// FileKeyProvider resolves each collection's key from a file named
+// dir/collectionName, expecting exactly 32 raw bytes.
+type FileKeyProvider struct {
+	Dir string
+}
+
+func (p FileKeyProvider) GetKey(collectionName string) ([]byte, string, error) {
+	path := joinPath(p.Dir, collectionName)
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, path, nil
+}
+
+// A KMS-backed KeyProvider (e.g. fetching data keys from AWS KMS / Vault)
+// can be added the same way, wiring GetKey to the KMS client and decrypting
+// a locally cached data key as needed - left out here to avoid pulling a
+// cloud SDK into this package.
@@ -1,12 +1,13 @@
 package gofiledb
 
 import (
-	"encoding/gob"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 /********************************************************************************
@@ -17,7 +18,11 @@ import (
 type Client struct {
 	ClientParams
 	collections   *collectionStore
-	isInitialized bool // IsInitialized ensures that we don't initialize the client more than once, since doing that could lead to issues
+	isInitialized bool             // IsInitialized ensures that we don't initialize the client more than once, since doing that could lead to issues
+	wal           *walWriter       // wal is nil unless replication (Primary or a configured PrimaryEndpoint) is enabled
+	walCheckpoint *walCheckpointer // walCheckpoint is non-nil whenever wal is; tracks in-flight LSNs so checkpointWAL never skips one
+	cdc           *cdcBuffer       // cdc backs Subscribe; always populated by New()
+	closeOnce     sync.Once
 	sync.RWMutex
 }
 
@@ -26,10 +31,50 @@ type ClientParams struct {
 	numPartitions      int    // numPartitions determines how many sub-folders should the package create inorder to partition the data
 	ignorePreviousData bool
 	enableGzip         bool
+	store              Store // store is the backend collections read/write through; defaults to a LocalFSStore when nil
+
+	// Replication knobs. Zero values mean "replication disabled" -
+	// mutations are applied directly with no WAL involved.
+	Primary         bool   // Primary marks this Client as the source of truth that secondaries Follow
+	PrimaryEndpoint string // PrimaryEndpoint is the http(s) address secondaries dial to fetch WAL segments
+	ReplicationPSK  string // ReplicationPSK is the shared secret sent/checked on every replication request
+	WALSegMinCount  int    // WALSegMinCount rolls a WAL segment once it holds this many records
+	WALSegMaxAgeSec int    // WALSegMaxAgeSec rolls a WAL segment once it has been open this long
+	WALSegGCAgeSec  int    // WALSegGCAgeSec removes sealed segments once they are this old
+
+	// CDC knobs for Client.Subscribe. Zero values fall back to sane
+	// defaults rather than disabling change capture.
+	CDCFlushIntervalSec int // CDCFlushIntervalSec is how often buffered events are flushed to disk
+	CDCSegmentSize      int // CDCSegmentSize flushes early once this many events are buffered
+	CDCRetentionSec     int // CDCRetentionSec removes flushed event segments once they are this old
+
+	// Cipher enables transparent encryption at rest. Every collection
+	// created while Cipher is true gets its own AES-256-GCM key from
+	// KeyProvider; encrypted and plaintext collections can coexist in one
+	// documentRoot, since the choice is captured per collection at
+	// AddCollection time, not globally.
+	//
+	// Cipher cannot be combined with replication (Primary or
+	// PrimaryEndpoint): the WAL carries plaintext payloads, so New() rejects
+	// the combination rather than silently shipping/storing it in clear.
+	Cipher      bool
+	KeyProvider KeyProvider
+
+	// NumKeyLockStripes shards each collection's in-process Get/Set
+	// locking across this many sync.RWMutex stripes instead of one lock
+	// per collection. CrossProcess additionally backs every collection
+	// with a flock(2)'d .lock file, so multiple OS processes pointing at
+	// the same documentRoot can share it safely.
+	NumKeyLockStripes int
+	CrossProcess      bool
 }
 
 type collectionStore struct {
-	Store map[string]Collection
+	// Store holds *Collection, not Collection, so every caller of
+	// getCollectionByName shares the same indexMu (and any other
+	// per-collection lock) instead of locking its own copy made by a
+	// map-value read.
+	Store map[string]*Collection
 	sync.RWMutex
 }
 
@@ -41,6 +86,15 @@ func NewClientParams(documentRoot string, numPartitions int) ClientParams {
 	return params
 }
 
+// NewClientParamsWithStore is identical to NewClientParams but lets the
+// caller swap in a non-default Store (e.g. a remote, shared backend)
+// instead of the LocalFSStore that New() builds otherwise.
+func NewClientParamsWithStore(documentRoot string, numPartitions int, store Store) ClientParams {
+	params := NewClientParams(documentRoot, numPartitions)
+	params.store = store
+	return params
+}
+
 /*** Local Getters ***/
 
 func (c *Client) getDocumentRoot() string {
@@ -63,8 +117,27 @@ func (c *Client) getCollectionByName(collectionName string) (*Collection, error)
 	if !hasKey {
 		return nil, ErrCollectionDoesNotExist
 	}
-	return &cl, nil
+	return cl, nil
 }
+
+// Close stops every background goroutine New() started for this Client
+// (cdc's flush loop, and the WAL's segment GC loop when replication is
+// enabled), so a Client that's done being used doesn't leak them for the
+// rest of the process's life. It is safe to call more than once. Callers
+// running Follow in a goroutine are still responsible for canceling its own
+// ctx themselves - Close does not touch it.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		if c.cdc != nil {
+			c.cdc.Close()
+		}
+		if c.wal != nil {
+			c.wal.Close()
+		}
+	})
+	return nil
+}
+
 func (c *Client) Destroy() error {
 	// remove everything related to this client, and refresh it
 	err := os.RemoveAll(c.getDocumentRoot())
@@ -91,50 +164,81 @@ func (c *Client) AddCollection(p CollectionProps) error {
 		return err
 	}
 
+	var buf bytes.Buffer
+	if err := gobEncode(&buf, p); err != nil {
+		return err
+	}
+	rec, err := c.logWAL(walOpAddCollection, p.Name, "", buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = c.applyAddCollection(p)
+	if err == nil {
+		c.logCDC(walOpAddCollection, p.Name, "", 0)
+	}
+	c.checkpointWAL(rec)
+	return err
+}
+
+func (c *Client) applyAddCollection(p CollectionProps) error {
+
 	// Create a Colelction and add to registered collections
 	var cl Collection
 	cl.CollectionProps = p
 
 	// Don't repeat collection names
-	c.registeredCollections.RLock()
-	_, hasKey := c.registeredCollections.Store[p.Name]
-	c.registeredCollections.RUnlock()
+	c.collections.RLock()
+	_, hasKey := c.collections.Store[p.Name]
+	c.collections.RUnlock()
 	if hasKey {
-		return fmt.Errorf("A collection with name %s already exists", p.Name)
+		return ErrCollectionAlreadyExists
 	}
 
-	// Create the required dir paths for this collection
+	// DirPath is informational only now (e.g. for log messages); the
+	// backing Store is responsible for laying out its own storage for
+	// the collection on first write.
 	cl.DirPath = c.getDirPathForCollection(p.Name)
-	// create the dirs for the collection
-	err = createDirIfNotExist(joinPath(cl.DirPath, META_DIR_NAME))
-	if err != nil {
-		return err
-	}
-	// for indexes
-	err = createDirIfNotExist(joinPath(cl.DirPath, META_DIR_NAME, "index"))
-	if err != nil {
-		return err
-	}
-	err = createDirIfNotExist(joinPath(cl.DirPath, DATA_DIR_NAME))
-	if err != nil {
-		return err
-	}
+
 	// Initialize the IndexStore, which stores info on the indexes associated with this Collection
 	cl.IndexStore.Store = make(map[string]IndexInfo)
+	cl.store = c.store
+	cl.locker = newKeyLocker(c.NumKeyLockStripes)
+
+	if c.CrossProcess {
+		if err := createDirIfNotExist(cl.DirPath); err != nil {
+			return err
+		}
+		flock, err := openFileLock(joinPath(cl.DirPath, ".lock"))
+		if err != nil {
+			return err
+		}
+		cl.flock = flock
+	}
+
+	if c.Cipher {
+		cipher, err := newCollectionCipher(c.KeyProvider, p.Name)
+		if err != nil {
+			return err
+		}
+		if err := c.store.PutMeta(p.Name, "cipher_info.gob", cipher.aead); err != nil {
+			return err
+		}
+		cl.cipher = cipher
+	}
 
 	// Register the Collection
 
-	c.registeredCollections.Lock()
-	defer c.registeredCollections.Unlock()
+	c.collections.Lock()
+	defer c.collections.Unlock()
 
 	// Initialize the collection store if not initialized (but it should already be initialized because of the Initialize() function)
-	if c.registeredCollections.Store == nil {
-		c.registeredCollections.Store = make(map[string]Collection)
+	if c.collections.Store == nil {
+		c.collections.Store = make(map[string]*Collection)
 	}
-	c.registeredCollections.Store[p.Name] = cl
+	c.collections.Store[p.Name] = &cl
 
-	err = c.setGlobalMetaStruct("registered_collections.gob", c.registeredCollections.Store)
-	if err != nil {
+	if err := c.setGlobalMetaStruct("registered_collections.gob", c.collections.Store); err != nil {
 		return err
 	}
 
@@ -143,25 +247,40 @@ func (c *Client) AddCollection(p CollectionProps) error {
 
 func (c *Client) RemoveCollection(collectionName string) error {
 
+	rec, err := c.logWAL(walOpRemoveCollection, collectionName, "", nil)
+	if err != nil {
+		return err
+	}
+
+	err = c.applyRemoveCollection(collectionName)
+	if err == nil {
+		c.logCDC(walOpRemoveCollection, collectionName, "", 0)
+	}
+	c.checkpointWAL(rec)
+	return err
+}
+
+func (c *Client) applyRemoveCollection(collectionName string) error {
+
 	cl, err := c.getCollectionByName(collectionName)
 	if err != nil {
 		return err
 	}
 
 	// Unregister the collection from the Client's Collection Store
-	c.registeredCollections.Lock()
-	defer c.registeredCollections.Unlock()
+	c.collections.Lock()
+	defer c.collections.Unlock()
 	clog.Infof("Removing collection registration...")
-	delete(c.registeredCollections.Store, collectionName)
+	delete(c.collections.Store, collectionName)
 
-	err = c.setGlobalMetaStruct("registered_collections.gob", c.registeredCollections.Store)
+	err = c.setGlobalMetaStruct("registered_collections.gob", c.collections.Store)
 	if err != nil {
 		return err
 	}
 
-	// Delete all the data & meta dirs for that collection
-	clog.Infof("Deleting data at %s...", cl.DirPath)
-	err = os.RemoveAll(cl.DirPath)
+	// Delete all the data & meta the Store holds for that collection
+	clog.Infof("Deleting data for collection %s...", cl.Name)
+	err = c.store.DeleteCollection(collectionName)
 	if err != nil {
 		return err
 	}
@@ -178,7 +297,17 @@ func (c *Client) Set(collectionName string, key string, data []byte) error {
 		return err
 	}
 
-	return cl.set(key, data)
+	rec, err := c.logWAL(walOpSet, collectionName, key, data)
+	if err != nil {
+		return err
+	}
+
+	err = cl.set(key, data)
+	if err == nil {
+		c.logCDC(walOpSet, collectionName, key, len(data))
+	}
+	c.checkpointWAL(rec)
+	return err
 }
 
 func (c *Client) SetStruct(collectionName string, key string, v interface{}) error {
@@ -188,7 +317,21 @@ func (c *Client) SetStruct(collectionName string, key string, v interface{}) err
 		return err
 	}
 
-	return cl.setFromStruct(key, v)
+	var buf bytes.Buffer
+	if err := gobEncode(&buf, v); err != nil {
+		return err
+	}
+	rec, err := c.logWAL(walOpSetStruct, collectionName, key, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = cl.setFromStruct(key, v)
+	if err == nil {
+		c.logCDC(walOpSetStruct, collectionName, key, 0)
+	}
+	c.checkpointWAL(rec)
+	return err
 }
 
 func (c *Client) SetFromReader(collectionName, key string, src io.Reader) error {
@@ -198,26 +341,99 @@ func (c *Client) SetFromReader(collectionName, key string, src io.Reader) error
 		return err
 	}
 
-	return cl.setFromReader(key, src)
-}
+	if c.wal == nil {
+		err = cl.setFromReader(key, src)
+		if err == nil {
+			c.logCDC(walOpSetFromReader, collectionName, key, 0)
+		}
+		return err
+	}
 
-func (c *Client) setGlobalMetaStruct(metaName string, v interface{}) error {
-	file, err := os.Create(joinPath(c.getDocumentRoot(), META_DIR_NAME, metaName))
+	// The WAL record needs the full payload, so buffer src once and feed
+	// the buffer to both the WAL and the Collection.
+	data, err := io.ReadAll(src)
 	if err != nil {
 		return err
 	}
-
-	enc := gob.NewEncoder(file)
-	err = enc.Encode(v)
+	rec, err := c.logWAL(walOpSetFromReader, collectionName, key, data)
 	if err != nil {
 		return err
 	}
-	return nil
+	err = cl.setFromReader(key, bytes.NewReader(data))
+	if err == nil {
+		c.logCDC(walOpSetFromReader, collectionName, key, len(data))
+	}
+	c.checkpointWAL(rec)
+	return err
+}
+
+// logWAL appends a WAL record for a mutation, a no-op (zero walRecord, nil
+// error) when replication is disabled (c.wal == nil). On success it marks
+// the record's LSN in flight with c.walCheckpoint, so a concurrent call that
+// finishes first can't checkpoint past it.
+func (c *Client) logWAL(op walOp, collectionName, key string, payload []byte) (walRecord, error) {
+	if c.wal == nil {
+		return walRecord{}, nil
+	}
+	rec, err := c.wal.Append(walRecord{Op: op, Collection: collectionName, Key: key, Payload: payload})
+	if err != nil {
+		return rec, err
+	}
+	c.walCheckpoint.start(rec.LSN)
+	return rec, nil
+}
+
+// checkpointWAL reports rec's LSN as applied to c.walCheckpoint and, if that
+// advances the safe floor (every LSN up to and including it is now known
+// applied), persists it so New() knows where to resume replaying from after
+// a crash. It is a no-op when replication is disabled. Callers must invoke
+// this whether or not their own apply succeeded - a failed apply still
+// needs its LSN cleared from c.walCheckpoint's pending set, or every lower
+// LSN's floor stays pinned below it forever. A failure here only delays
+// recovery (the next call that advances the floor tries again), so it is
+// logged rather than surfaced to the caller.
+func (c *Client) checkpointWAL(rec walRecord) {
+	if c.wal == nil {
+		return
+	}
+	floor, ok := c.walCheckpoint.finish(rec.LSN)
+	if !ok {
+		return
+	}
+	if err := c.saveCheckpoint(floor); err != nil {
+		clog.Errorf("failed to persist WAL checkpoint at LSN %d: %v", floor, err)
+	}
+}
+
+// logCDC records a change event for Subscribe's consumers.
+func (c *Client) logCDC(op walOp, collectionName, key string, size int) {
+	c.cdc.append(Event{Ts: time.Now(), Collection: collectionName, Key: key, Op: op, Size: size})
+}
+
+func (c *Client) setGlobalMetaStruct(metaName string, v interface{}) error {
+	return c.store.PutMeta("", metaName, v)
+}
+
+// saveCheckpoint persists lsn as the WAL checkpoint: the LSN up to which
+// every record is known to be durably applied to the Store.
+func (c *Client) saveCheckpoint(lsn uint64) error {
+	return c.setGlobalMetaStruct(walCheckpointMetaName, lsn)
+}
+
+// loadCheckpoint returns the last persisted WAL checkpoint, or 0 if none has
+// been saved yet (a brand new documentRoot, or one with no history to replay).
+func (c *Client) loadCheckpoint() (uint64, error) {
+	var lsn uint64
+	err := c.getGlobalMetaStruct(walCheckpointMetaName, &lsn)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return lsn, err
 }
 
 /*** Data Readers ***/
 
-func (c *Client) GetFile(collectionName, key string) (*os.File, error) {
+func (c *Client) GetFile(collectionName, key string) (io.ReadCloser, error) {
 	cl, err := c.getCollectionByName(collectionName)
 	if err != nil {
 		return nil, err
@@ -274,21 +490,17 @@ func (c *Client) GetIntoWriter(collectionName, key string, dest io.Writer) error
 }
 
 func (c *Client) getGlobalMetaStruct(metaName string, v interface{}) error {
-	file, err := os.Open(joinPath(c.getDocumentRoot(), META_DIR_NAME, metaName))
-	if err != nil {
-		return err
-	}
-	dec := gob.NewDecoder(file)
-	err = dec.Decode(v)
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.store.GetMeta("", metaName, v)
 }
 
 /** Searchers **/
-// Todo: search()
-func (c *Client) Search(collectionName string, query string) ([]interface{}, error) {
+
+// Search parses query (e.g. `field:value AND (other:>=10 OR tag:"foo bar")`)
+// and evaluates it against collectionName's indexes, returning a paginated
+// SearchResult over the matching documents. Every field referenced in query
+// must have a matching AddIndex (or AddRangeIndex, for range predicates)
+// call first, or Search returns ErrIndexDoesNotExist.
+func (c *Client) Search(collectionName string, query string) (*SearchResult, error) {
 
 	cl, err := c.getCollectionByName(collectionName)
 	if err != nil {
@@ -298,6 +510,10 @@ func (c *Client) Search(collectionName string, query string) ([]interface{}, err
 	return cl.search(query)
 }
 
+// AddIndex builds a term index over fieldLocator (a dot-separated path into
+// each document's JSON representation, e.g. "author.name"), backfilling it
+// against every document already in the collection. Equality predicates in
+// Search queries (field:value) resolve against this index.
 func (c *Client) AddIndex(collectionName string, fieldLocator string) error {
 
 	cl, err := c.getCollectionByName(collectionName)
@@ -305,7 +521,34 @@ func (c *Client) AddIndex(collectionName string, fieldLocator string) error {
 		return err
 	}
 
-	return cl.addIndex(fieldLocator)
+	rec, err := c.logWAL(walOpAddIndex, collectionName, fieldLocator, nil)
+	if err != nil {
+		return err
+	}
+
+	err = cl.addIndex(fieldLocator)
+	c.checkpointWAL(rec)
+	return err
+}
+
+// AddRangeIndex is identical to AddIndex but stores fieldLocator's postings
+// sorted by value, so Search can resolve range predicates (field:>=10)
+// against it without scanning every value in the index.
+func (c *Client) AddRangeIndex(collectionName string, fieldLocator string) error {
+
+	cl, err := c.getCollectionByName(collectionName)
+	if err != nil {
+		return err
+	}
+
+	rec, err := c.logWAL(walOpAddRangeIndex, collectionName, fieldLocator, nil)
+	if err != nil {
+		return err
+	}
+
+	err = cl.addRangeIndex(fieldLocator)
+	c.checkpointWAL(rec)
+	return err
 }
 
 /*** Navigation Helpers ***/
@@ -351,6 +594,14 @@ func (p ClientParams) validate() error {
 	if !info.IsDir() {
 		return fmt.Errorf("%s path is not a directory", p.documentRoot)
 	}
+	// Cipher only encrypts what Collection.put/get write to the Store; the
+	// WAL records logWAL appends ahead of that (and RepHandler/pullOnce ship
+	// over HTTP) carry the plaintext payload, so combining Cipher with
+	// replication would durably store and transmit in clear what Cipher is
+	// meant to protect.
+	if p.Cipher && (p.Primary || p.PrimaryEndpoint != "") {
+		return fmt.Errorf("Cipher cannot be combined with replication (Primary or PrimaryEndpoint): WAL records are not encrypted, so doing so would store/ship plaintext despite Cipher")
+	}
 
 	return nil
 }
@@ -368,4 +619,4 @@ func (p ClientParams) sanitize() ClientParams {
 
 	return p
 
-}
\ No newline at end of file
+}
@@ -0,0 +1,75 @@
+package gofiledb
+
+import "testing"
+
+// TestCloseStopsBackgroundGoroutines checks that Close actually waits for the
+// goroutines New() started to return. Previously there was no Close at all:
+// every Client leaked cdc's flushLoop (and, with replication enabled, the
+// WAL's gc loop) for the life of the process - visible under -race as
+// flushLoop still firing against a t.TempDir() the test had already torn
+// down. Close now blocks on each loop's done channel, so by the time it
+// returns here the loops are provably gone rather than merely likely gone.
+func TestCloseStopsBackgroundGoroutines(t *testing.T) {
+	params := newTestClientParams(t, true)
+	c, err := New(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.cdc == nil {
+		t.Fatal("expected cdc to be enabled by newTestClientParams")
+	}
+	if c.wal == nil {
+		t.Fatal("expected wal to be enabled by newTestClientParams(t, true)")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-c.cdc.done:
+	default:
+		t.Fatal("cdcBuffer.flushLoop still running after Close")
+	}
+	select {
+	case <-c.wal.done:
+	default:
+		t.Fatal("walWriter.gcLoop still running after Close")
+	}
+}
+
+// TestCloseIsIdempotent checks that a second Close doesn't panic (e.g. from
+// closing an already-closed stop channel twice).
+func TestCloseIsIdempotent(t *testing.T) {
+	c, err := New(newTestClientParams(t, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCipherRejectsReplication checks that New() refuses Cipher combined
+// with either replication role. logWAL appends a record's plaintext payload
+// before cl.set ever reaches Collection's cipher, so allowing this
+// combination would durably store (and, over HTTP, ship) in clear what
+// Cipher is supposed to protect.
+func TestCipherRejectsReplication(t *testing.T) {
+	primary := newTestClientParams(t, true)
+	primary.Cipher = true
+	if _, err := New(primary); err == nil {
+		t.Fatal("expected New to reject Cipher combined with Primary")
+	}
+
+	secondary := newTestClientParams(t, false)
+	secondary.PrimaryEndpoint = "http://localhost:0"
+	secondary.Cipher = true
+	if _, err := New(secondary); err == nil {
+		t.Fatal("expected New to reject Cipher combined with PrimaryEndpoint")
+	}
+}
@@ -0,0 +1,252 @@
+package gofiledb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+/********************************************************************************
+* C O L L E C T I O N
+*********************************************************************************/
+
+// CollectionProps holds the user supplied configuration for a Collection
+type CollectionProps struct {
+	Name string
+}
+
+func (p CollectionProps) sanitize() CollectionProps {
+	p.Name = strings.TrimSpace(p.Name)
+	return p
+}
+
+func (p CollectionProps) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("Empty collection Name provided")
+	}
+	return nil
+}
+
+// IndexInfo describes a single field index registered on a Collection
+type IndexInfo struct {
+	FieldLocator string
+	// Range marks an index built with AddRangeIndex: its postings are
+	// stored sorted by value so Search can answer range predicates
+	// (field:>=10) without a full scan.
+	Range bool
+}
+
+// IndexStore holds every index currently registered for a Collection, keyed
+// by field locator
+type IndexStore struct {
+	Store map[string]IndexInfo
+}
+
+// Collection represents a named, partitioned set of keyed documents. All of
+// its reads and writes go through the Client-wide Store, so a Collection
+// itself holds no filesystem state beyond its own name and dir path (and,
+// with ClientParams.CrossProcess, its open .lock file).
+type Collection struct {
+	CollectionProps
+	DirPath    string
+	IndexStore IndexStore
+	store      Store
+	cipher     *collectionCipher // cipher is nil unless this collection was created with ClientParams.Cipher enabled
+	locker     *keyLocker        // locker shards in-process Get/Set contention across keys instead of one collection-wide lock
+	flock      *fileLock         // flock is non-nil only when ClientParams.CrossProcess is enabled
+	indexMu    sync.Mutex        // indexMu serializes reads/rebuilds of this collection's postings, independent of locker's per-key stripes
+}
+
+// put writes src to the Store, transparently sealing it first if this
+// collection is encrypted. It holds the write (exclusive) lock for key, and
+// - if this collection has any indexes registered - keeps their postings in
+// sync with the write.
+//
+// indexMu is held for the whole call, taken before locker. buildIndex reads
+// every key under indexMu alone (through readRawLocked, without locker), so
+// holding indexMu here keeps a write from interleaving with a concurrent
+// AddIndex/AddRangeIndex rebuild.
+func (cl *Collection) put(key string, src io.Reader) error {
+	cl.indexMu.Lock()
+	defer cl.indexMu.Unlock()
+
+	cl.locker.Lock(key)
+	defer cl.locker.Unlock(key)
+
+	if cl.flock != nil {
+		if err := cl.flock.Lock(); err != nil {
+			return err
+		}
+		defer cl.flock.Unlock()
+	}
+
+	hasIndexes := len(cl.IndexStore.Store) > 0
+
+	var oldData, newData []byte
+	if hasIndexes {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+		newData = data
+		src = bytes.NewReader(data)
+
+		// Best-effort: key may not exist yet, in which case there is no
+		// old posting to retract. Bypasses cl.get, since locker/flock are
+		// already held for key by this call.
+		oldData, _ = cl.readRawLocked(key)
+	}
+
+	if cl.cipher != nil {
+		sealed, err := cl.cipher.seal(src)
+		if err != nil {
+			return err
+		}
+		src = sealed
+	}
+
+	if err := cl.store.Put(cl.Name, key, src); err != nil {
+		return err
+	}
+
+	if hasIndexes {
+		return cl.updateIndexesForKey(key, oldData, newData)
+	}
+	return nil
+}
+
+// readRawLocked reads and decrypts key's current value without taking
+// locker or flock, for callers that already hold broader locks covering key:
+// put already holds locker.Lock(key) itself, so calling cl.get's
+// locker.RLock(key) too would deadlock against its own write lock; buildIndex
+// holds indexMu (and flock, if any) for the whole rebuild, so calling cl.get's
+// flock.RLock would silently convert-then-drop that outer exclusive lock,
+// since flock(2) re-locks on the same open file description aren't nested.
+func (cl *Collection) readRawLocked(key string) ([]byte, error) {
+	r, err := cl.store.Get(cl.Name, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if cl.cipher == nil {
+		return io.ReadAll(r)
+	}
+	opened, err := cl.cipher.open(r)
+	if err != nil {
+		return nil, err
+	}
+	defer opened.Close()
+	return io.ReadAll(opened)
+}
+
+// get opens key from the Store, transparently decrypting it first if this
+// collection is encrypted. It holds the read (shared) lock for key until the
+// returned ReadCloser is closed, not just until the Store open returns -
+// otherwise a concurrent put could truncate/rewrite the file out from under
+// a caller still streaming the old one.
+func (cl *Collection) get(key string) (io.ReadCloser, error) {
+	cl.locker.RLock(key)
+
+	if cl.flock != nil {
+		if err := cl.flock.RLock(); err != nil {
+			cl.locker.RUnlock(key)
+			return nil, err
+		}
+	}
+
+	unlock := func() {
+		if cl.flock != nil {
+			cl.flock.Unlock()
+		}
+		cl.locker.RUnlock(key)
+	}
+
+	r, err := cl.store.Get(cl.Name, key)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	if cl.cipher == nil {
+		return &unlockingReadCloser{ReadCloser: r, unlock: unlock}, nil
+	}
+
+	opened, err := cl.cipher.open(r)
+	r.Close()
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return &unlockingReadCloser{ReadCloser: opened, unlock: unlock}, nil
+}
+
+// unlockingReadCloser defers releasing the locks get() acquired until the
+// caller has finished reading, by running unlock exactly once from Close.
+type unlockingReadCloser struct {
+	io.ReadCloser
+	once   sync.Once
+	unlock func()
+}
+
+func (u *unlockingReadCloser) Close() error {
+	err := u.ReadCloser.Close()
+	u.once.Do(u.unlock)
+	return err
+}
+
+func (cl *Collection) set(key string, data []byte) error {
+	return cl.put(key, bytes.NewReader(data))
+}
+
+func (cl *Collection) setFromStruct(key string, v interface{}) error {
+	var buf bytes.Buffer
+	if err := gobEncode(&buf, v); err != nil {
+		return err
+	}
+	return cl.put(key, &buf)
+}
+
+func (cl *Collection) setFromReader(key string, src io.Reader) error {
+	return cl.put(key, src)
+}
+
+func (cl *Collection) getFile(key string) (io.ReadCloser, error) {
+	return cl.get(key)
+}
+
+func (cl *Collection) getFileData(key string) ([]byte, error) {
+	r, err := cl.get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+func (cl *Collection) getIntoStruct(key string, dest interface{}) error {
+	r, err := cl.get(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return gobDecode(r, dest)
+}
+
+func (cl *Collection) getIntoWriter(key string, dest io.Writer) error {
+	r, err := cl.get(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(dest, r)
+	return err
+}
+
+// addIndex, addRangeIndex and search are implemented in search.go alongside
+// the rest of the query engine they share (postings storage, query parsing).
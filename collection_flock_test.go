@@ -0,0 +1,72 @@
+//go:build linux || darwin
+
+package gofiledb
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+// TestAddIndexHoldsFlockForWholeRebuild drives AddIndex with CrossProcess
+// enabled and, concurrently, repeatedly tries to steal the same collection's
+// .lock file with a separate, non-blocking flock(2) exclusive lock (a fresh
+// open file description, the same way an independent process would see it).
+// buildIndex's per-key loop used to read each document through cl.get, which
+// re-acquired cl.flock as a shared lock and released it on Close - since
+// flock(2) re-locks on the same open file description are a conversion/
+// release rather than a nest, that silently dropped withIndexLock's own
+// exclusive lock after the very first key, leaving the rest of the rebuild
+// unprotected against a concurrent cross-process writer.
+func TestAddIndexHoldsFlockForWholeRebuild(t *testing.T) {
+	params := newTestClientParams(t, false)
+	params.CrossProcess = true
+
+	c := newTestClient(t, params)
+	if err := c.AddCollection(CollectionProps{Name: "items"}); err != nil {
+		t.Fatal(err)
+	}
+
+	const numKeys = 5000
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if err := c.Set("items", key, mustMarshal(t, map[string]interface{}{"tag": "x"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lockPath := joinPath(c.getDirPathForCollection("items"), ".lock")
+
+	done := make(chan struct{})
+	var stolen atomic.Bool
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			fl, err := os.OpenFile(lockPath, os.O_RDWR, 0644)
+			if err != nil {
+				continue
+			}
+			if err := syscall.Flock(int(fl.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+				stolen.Store(true)
+				syscall.Flock(int(fl.Fd()), syscall.LOCK_UN)
+			}
+			fl.Close()
+		}
+	}()
+
+	if err := c.AddIndex("items", "tag"); err != nil {
+		close(done)
+		t.Fatal(err)
+	}
+	close(done)
+
+	if stolen.Load() {
+		t.Fatal("a concurrent flock(2) attempt acquired the collection lock while AddIndex's rebuild was still in flight")
+	}
+}
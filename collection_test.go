@@ -0,0 +1,143 @@
+package gofiledb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentSetAndAddIndex drives concurrent Set and AddIndex calls
+// against the same collection. put() used to take locker.Lock(key) before
+// reaching for indexMu to update postings, while buildIndex took indexMu
+// before locker (to read existing keys) - an AB-BA lock order that deadlocks
+// as soon as indexMu is an actual shared lock instead of a copied-by-value
+// no-op.
+func TestConcurrentSetAndAddIndex(t *testing.T) {
+	params := newTestClientParams(t, false)
+
+	c := newTestClient(t, params)
+	if err := c.AddCollection(CollectionProps{Name: "items"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddIndex("items", "tag"); err != nil {
+		t.Fatal(err)
+	}
+
+	const numWriters = 20
+	const numIndexers = 5
+
+	var wg sync.WaitGroup
+	wg.Add(numWriters + numIndexers)
+	for i := 0; i < numWriters; i++ {
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("k%d", i)
+			tag := "even"
+			if i%2 != 0 {
+				tag = "odd"
+			}
+			if err := c.Set("items", key, mustMarshal(t, map[string]interface{}{"tag": tag})); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	for i := 0; i < numIndexers; i++ {
+		go func() {
+			defer wg.Done()
+			if err := c.AddIndex("items", "tag"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	res, err := c.Search("items", "tag:even")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	var found int
+	for {
+		key, _, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key == "" {
+			break
+		}
+		found++
+	}
+	if found != numWriters/2 {
+		t.Fatalf("found %d documents tagged even, want %d", found, numWriters/2)
+	}
+}
+
+// TestGetHoldsLockUntilClose drives a Set concurrently with an in-progress
+// GetFile on the same key. get() used to release locker/flock as soon as the
+// Store's reader was opened, before the caller read a single byte, so a
+// concurrent put could truncate the file mid-read. The read must instead see
+// the old value in full, and the concurrent Set must not complete until the
+// read's ReadCloser is closed.
+func TestGetHoldsLockUntilClose(t *testing.T) {
+	params := newTestClientParams(t, false)
+
+	c := newTestClient(t, params)
+	if err := c.AddCollection(CollectionProps{Name: "items"}); err != nil {
+		t.Fatal(err)
+	}
+
+	oldData := bytes.Repeat([]byte("a"), 64*1024)
+	if err := c.Set("items", "k", oldData); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.GetFile("items", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := make([]byte, 4)
+	if _, err := io.ReadFull(r, first); err != nil {
+		t.Fatal(err)
+	}
+
+	setDone := make(chan struct{})
+	go func() {
+		defer close(setDone)
+		if err := c.Set("items", "k", []byte("new")); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	select {
+	case <-setDone:
+		t.Fatal("Set completed while a reader was still open on the same key")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	<-setDone
+
+	got := append(first, rest...)
+	if !bytes.Equal(got, oldData) {
+		t.Fatalf("concurrent Set corrupted the in-flight Get: got %d bytes, want %d bytes of the old value", len(got), len(oldData))
+	}
+
+	newData, err := c.Get("items", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(newData) != "new" {
+		t.Fatalf("Get after Close = %q, want %q", newData, "new")
+	}
+}
@@ -0,0 +1,31 @@
+package gofiledb
+
+import (
+	"fmt"
+	"log"
+)
+
+// Directory and file naming conventions used across the package
+const (
+	META_DIR_NAME         = "_meta"
+	DATA_DIR_NAME         = "_data"
+	DATA_PARTITION_PREFIX = "partition_"
+)
+
+// packageLogger is a thin wrapper around *log.Logger that adds the leveled
+// Infof/Errorf helpers the rest of the package calls into.
+type packageLogger struct {
+	*log.Logger
+}
+
+func (l packageLogger) Infof(format string, args ...interface{}) {
+	l.Output(2, "[INFO] "+fmt.Sprintf(format, args...))
+}
+
+func (l packageLogger) Errorf(format string, args ...interface{}) {
+	l.Output(2, "[ERROR] "+fmt.Sprintf(format, args...))
+}
+
+// clog is the package level logger used for operational messages (collection
+// registration, teardown, etc.)
+var clog = packageLogger{log.New(log.Writer(), "[gofiledb] ", log.LstdFlags)}
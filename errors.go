@@ -0,0 +1,11 @@
+package gofiledb
+
+import "errors"
+
+// Sentinel errors returned by Client and Collection methods
+var (
+	ErrCollectionDoesNotExist  = errors.New("gofiledb: collection does not exist")
+	ErrCollectionAlreadyExists = errors.New("gofiledb: collection already exists")
+	ErrKeyDoesNotExist         = errors.New("gofiledb: key does not exist")
+	ErrIndexDoesNotExist       = errors.New("gofiledb: index does not exist")
+)
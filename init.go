@@ -0,0 +1,108 @@
+package gofiledb
+
+import "os"
+
+// New sanitizes and validates params, then builds a Client ready to have
+// collections registered on it. If params.store is nil, a LocalFSStore
+// rooted at the sanitized documentRoot is used.
+func New(params ClientParams) (*Client, error) {
+	params = params.sanitize()
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	if !params.ignorePreviousData {
+		if err := createDirIfNotExist(params.documentRoot); err != nil {
+			return nil, err
+		}
+	}
+	if err := createDirIfNotExist(joinPath(params.documentRoot, META_DIR_NAME)); err != nil {
+		return nil, err
+	}
+
+	if params.store == nil {
+		params.store = NewLocalFSStore(params.documentRoot, params.numPartitions)
+	}
+
+	c := &Client{
+		ClientParams: params,
+		collections:  &collectionStore{Store: make(map[string]*Collection)},
+	}
+
+	// Restore any collections registered by a previous process/run
+	var registered map[string]*Collection
+	err := c.getGlobalMetaStruct("registered_collections.gob", &registered)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for name, cl := range registered {
+		cl.store = c.store
+		cl.locker = newKeyLocker(params.NumKeyLockStripes)
+		if params.CrossProcess {
+			flock, err := openFileLock(joinPath(cl.DirPath, ".lock"))
+			if err != nil {
+				return nil, err
+			}
+			cl.flock = flock
+		}
+		if params.Cipher {
+			var info CipherInfo
+			if err := c.store.GetMeta(name, "cipher_info.gob", &info); err == nil {
+				cipher, err := newCollectionCipher(params.KeyProvider, name)
+				if err != nil {
+					return nil, err
+				}
+				cl.cipher = cipher
+			}
+		}
+
+		// registered_collections.gob is only rewritten on
+		// AddCollection/RemoveCollection, so it always reflects this
+		// collection's index set as of creation time (empty). The live
+		// index set lives in "index_store.gob", kept up to date by every
+		// AddIndex/AddRangeIndex, so reload it here instead of trusting
+		// the stale snapshot - otherwise indexes silently stop being
+		// maintained for any collection that survives a restart.
+		var indexes map[string]IndexInfo
+		if err := c.store.GetMeta(name, "index_store.gob", &indexes); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		} else if err == nil {
+			cl.IndexStore.Store = indexes
+		}
+
+		c.collections.Store[name] = cl
+	}
+
+	// A WAL is only needed once replication is in play: a primary logs
+	// mutations for secondaries to pull, a secondary needs one to track
+	// the LSN it has applied up to.
+	if params.Primary || params.PrimaryEndpoint != "" {
+		c.wal, err = newWALWriter(params.documentRoot, params.WALSegMinCount, params.WALSegMaxAgeSec, params.WALSegGCAgeSec)
+		if err != nil {
+			return nil, err
+		}
+
+		// Replay anything past the last checkpoint before this Client
+		// starts serving reads, so a crash between a WAL append and the
+		// mutation it describes landing in the Store - or, on a
+		// secondary, between mirroring a pulled record and applying it -
+		// is recovered rather than silently lost.
+		if err := c.replayWAL(); err != nil {
+			return nil, err
+		}
+
+		checkpoint, err := c.loadCheckpoint()
+		if err != nil {
+			return nil, err
+		}
+		c.walCheckpoint = newWALCheckpointer(checkpoint)
+	}
+
+	c.cdc, err = newCDCBuffer(params.documentRoot, params.CDCFlushIntervalSec, params.CDCSegmentSize, params.CDCRetentionSec)
+	if err != nil {
+		return nil, err
+	}
+
+	c.isInitialized = true
+	return c, nil
+}
@@ -0,0 +1,49 @@
+package gofiledb
+
+import "testing"
+
+// TestIndexSurvivesRestart checks that a collection's indexes keep being
+// maintained after a restart. registered_collections.gob only captures a
+// collection's index set as of AddCollection time (always empty), so a
+// Client that restored IndexStore.Store solely from that snapshot would
+// silently stop indexing new documents for any collection surviving a
+// restart.
+func TestIndexSurvivesRestart(t *testing.T) {
+	params := newTestClientParams(t, false)
+
+	c := newTestClient(t, params)
+	if err := c.AddCollection(CollectionProps{Name: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("docs", "k1", mustMarshal(t, map[string]interface{}{"tag": "foo"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddIndex("docs", "tag"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newTestClient(t, params)
+	if err := restarted.Set("docs", "k2", mustMarshal(t, map[string]interface{}{"tag": "foo"})); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := restarted.Search("docs", "tag:foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	var keys []string
+	for {
+		key, _, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key == "" {
+			break
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("found keys %v, want both k1 and k2", keys)
+	}
+}
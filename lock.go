@@ -0,0 +1,34 @@
+package gofiledb
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const defaultNumKeyLockStripes = 32
+
+// keyLocker hashes a key into one of N stripes of sync.RWMutex, so writers
+// to different keys within the same Collection don't contend on a single
+// collection-wide lock. Reads and writes to the same key still serialize
+// through whichever stripe that key hashes to.
+type keyLocker struct {
+	stripes []sync.RWMutex
+}
+
+func newKeyLocker(numStripes int) *keyLocker {
+	if numStripes <= 0 {
+		numStripes = defaultNumKeyLockStripes
+	}
+	return &keyLocker{stripes: make([]sync.RWMutex, numStripes)}
+}
+
+func (kl *keyLocker) stripeFor(key string) *sync.RWMutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &kl.stripes[h.Sum32()%uint32(len(kl.stripes))]
+}
+
+func (kl *keyLocker) RLock(key string)   { kl.stripeFor(key).RLock() }
+func (kl *keyLocker) RUnlock(key string) { kl.stripeFor(key).RUnlock() }
+func (kl *keyLocker) Lock(key string)    { kl.stripeFor(key).Lock() }
+func (kl *keyLocker) Unlock(key string)  { kl.stripeFor(key).Unlock() }
@@ -0,0 +1,39 @@
+//go:build linux || darwin
+
+package gofiledb
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileLock wraps a collection's on-disk .lock file, flock(2)'d shared for
+// reads and exclusive for writes, so multiple OS processes pointing at the
+// same documentRoot can safely share it.
+type fileLock struct {
+	file *os.File
+}
+
+func openFileLock(path string) (*fileLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileLock{file: file}, nil
+}
+
+func (fl *fileLock) RLock() error {
+	return syscall.Flock(int(fl.file.Fd()), syscall.LOCK_SH)
+}
+
+func (fl *fileLock) Lock() error {
+	return syscall.Flock(int(fl.file.Fd()), syscall.LOCK_EX)
+}
+
+func (fl *fileLock) Unlock() error {
+	return syscall.Flock(int(fl.file.Fd()), syscall.LOCK_UN)
+}
+
+func (fl *fileLock) Close() error {
+	return fl.file.Close()
+}
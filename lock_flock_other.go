@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package gofiledb
+
+import "fmt"
+
+// fileLock is a stub on platforms without flock(2); ClientParams.CrossProcess
+// is rejected at collection-creation time instead of silently not locking.
+type fileLock struct{}
+
+func openFileLock(path string) (*fileLock, error) {
+	return nil, fmt.Errorf("gofiledb: CrossProcess locking is not supported on this platform")
+}
+
+func (fl *fileLock) RLock() error  { return nil }
+func (fl *fileLock) Lock() error   { return nil }
+func (fl *fileLock) Unlock() error { return nil }
+func (fl *fileLock) Close() error  { return nil }
@@ -0,0 +1,691 @@
+package gofiledb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/********************************************************************************
+* Q U E R Y   P A R S I N G
+*********************************************************************************/
+
+// A query is parsed into a tree of these nodes: leaves are field predicates,
+// interior nodes combine their children with AND/OR/NOT.
+//
+//	field:value               -> equality leaf
+//	field:>=10, field:<10, ... -> range leaf (range-indexed fields only)
+//	a AND (b OR NOT c)         -> boolean nodes
+type queryNode interface {
+	// eval resolves this node against cl's indexes into the set
+	// of matching document keys.
+	eval(cl *Collection) (map[string]bool, error)
+}
+
+type termNode struct {
+	field string
+	value string
+}
+
+type rangeOp string
+
+const (
+	rangeGTE rangeOp = ">="
+	rangeGT  rangeOp = ">"
+	rangeLTE rangeOp = "<="
+	rangeLT  rangeOp = "<"
+)
+
+type rangeNode struct {
+	field string
+	op    rangeOp
+	value string
+}
+
+type boolNode struct {
+	op       string // "AND", "OR", "NOT"
+	children []queryNode
+}
+
+func (n termNode) eval(cl *Collection) (map[string]bool, error) {
+	postings, err := loadPostings(cl, n.field)
+	if err != nil {
+		return nil, err
+	}
+	return setOf(postings[n.value]), nil
+}
+
+func (n rangeNode) eval(cl *Collection) (map[string]bool, error) {
+	entries, err := loadRangePostings(cl, n.field)
+	if err != nil {
+		return nil, err
+	}
+
+	// The query's value is a raw string (e.g. "5"), but entries were
+	// encoded with sortableEncode at index time (e.g. "5" as a number
+	// becomes "1000000000005.000000"). Run it through the same encoding,
+	// parsed as a number when it looks like one, so the comparison below
+	// is between two values in the same representation.
+	queryValue := n.value
+	if f, err := strconv.ParseFloat(n.value, 64); err == nil {
+		queryValue = sortableEncode(f)
+	}
+
+	// entries is kept sorted by Value, so the matches for >=/> form a suffix
+	// of it and those for <=/< a prefix: binary search for the boundary
+	// instead of testing every entry.
+	lo, hi := 0, len(entries)
+	switch n.op {
+	case rangeGTE, rangeGT:
+		lo = sort.Search(len(entries), func(i int) bool { return rangeMatches(n.op, entries[i].Value, queryValue) })
+	case rangeLTE, rangeLT:
+		hi = sort.Search(len(entries), func(i int) bool { return !rangeMatches(n.op, entries[i].Value, queryValue) })
+	}
+
+	matched := make(map[string]bool, hi-lo)
+	for _, e := range entries[lo:hi] {
+		matched[e.Key] = true
+	}
+	return matched, nil
+}
+
+func rangeMatches(op rangeOp, docValue, queryValue string) bool {
+	cmp := strings.Compare(docValue, queryValue)
+	switch op {
+	case rangeGTE:
+		return cmp >= 0
+	case rangeGT:
+		return cmp > 0
+	case rangeLTE:
+		return cmp <= 0
+	case rangeLT:
+		return cmp < 0
+	}
+	return false
+}
+
+func (n boolNode) eval(cl *Collection) (map[string]bool, error) {
+	switch n.op {
+	case "NOT":
+		child, err := n.children[0].eval(cl)
+		if err != nil {
+			return nil, err
+		}
+		all, err := allKeys(cl)
+		if err != nil {
+			return nil, err
+		}
+		return setDifference(all, child), nil
+	case "AND":
+		result, err := n.children[0].eval(cl)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range n.children[1:] {
+			next, err := child.eval(cl)
+			if err != nil {
+				return nil, err
+			}
+			result = setIntersect(result, next)
+		}
+		return result, nil
+	case "OR":
+		result := make(map[string]bool)
+		for _, child := range n.children {
+			next, err := child.eval(cl)
+			if err != nil {
+				return nil, err
+			}
+			result = setUnion(result, next)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("gofiledb: unknown boolean operator %q", n.op)
+}
+
+func setOf(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+func setIntersect(a, b map[string]bool) map[string]bool {
+	out := make(map[string]bool)
+	for k := range a {
+		if b[k] {
+			out[k] = true
+		}
+	}
+	return out
+}
+
+func setUnion(a, b map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		out[k] = true
+	}
+	for k := range b {
+		out[k] = true
+	}
+	return out
+}
+
+func setDifference(a, b map[string]bool) map[string]bool {
+	out := make(map[string]bool)
+	for k := range a {
+		if !b[k] {
+			out[k] = true
+		}
+	}
+	return out
+}
+
+func allKeys(cl *Collection) (map[string]bool, error) {
+	keys, err := cl.store.List(cl.Name)
+	if err != nil {
+		return nil, err
+	}
+	return setOf(keys), nil
+}
+
+// parseQuery turns a query string like `field:value AND (other:>=10 OR
+// tag:"foo bar")` into a queryNode tree. The grammar is a small, left to
+// right recursive descent over OR-of-ANDs-of-(NOT-)atoms, where an atom is
+// either a parenthesized expression or a single `field:predicate` term.
+func parseQuery(query string) (queryNode, error) {
+	p := &queryParser{tokens: tokenizeQuery(query)}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("gofiledb: unexpected token %q in query", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []queryNode{left}
+	for strings.EqualFold(p.peek(), "OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return boolNode{op: "OR", children: children}, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	children := []queryNode{left}
+	for strings.EqualFold(p.peek(), "AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return boolNode{op: "AND", children: children}, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if strings.EqualFold(p.peek(), "NOT") {
+		p.next()
+		child, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		return boolNode{op: "NOT", children: []queryNode{child}}, nil
+	}
+	return p.parseAtom()
+}
+
+func (p *queryParser) parseAtom() (queryNode, error) {
+	if p.peek() == "(" {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("gofiledb: expected ')' in query")
+		}
+		p.next()
+		return node, nil
+	}
+
+	tok := p.next()
+	if tok == "" {
+		return nil, fmt.Errorf("gofiledb: unexpected end of query")
+	}
+	return parseTerm(tok)
+}
+
+// parseTerm splits a single `field:predicate` token into a term or range
+// leaf, e.g. `age:>=10` or `tag:"foo bar"`.
+func parseTerm(tok string) (queryNode, error) {
+	idx := strings.Index(tok, ":")
+	if idx < 0 {
+		return nil, fmt.Errorf("gofiledb: malformed query term %q, want field:value", tok)
+	}
+	field, predicate := tok[:idx], tok[idx+1:]
+
+	for _, op := range []rangeOp{rangeGTE, rangeLTE, rangeGT, rangeLT} {
+		if strings.HasPrefix(predicate, string(op)) {
+			return rangeNode{field: field, op: op, value: strings.TrimPrefix(predicate, string(op))}, nil
+		}
+	}
+
+	predicate = strings.TrimPrefix(predicate, "\"")
+	predicate = strings.TrimSuffix(predicate, "\"")
+	return termNode{field: field, value: predicate}, nil
+}
+
+// tokenizeQuery splits a query string into tokens, keeping quoted strings
+// (and their spaces) and parentheses intact.
+func tokenizeQuery(query string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inQuotes := false
+
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			cur.WriteRune(r)
+		case inQuotes:
+			cur.WriteRune(r)
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+/********************************************************************************
+* I N D E X   S T O R A G E
+*********************************************************************************/
+
+func indexMetaName(fieldLocator string) string {
+	return joinPath("index", fieldLocator+".gob")
+}
+
+// loadPostings reads the term index for fieldLocator: value -> matching keys.
+func loadPostings(cl *Collection, fieldLocator string) (map[string][]string, error) {
+	postings := make(map[string][]string)
+	err := cl.store.GetMeta(cl.Name, indexMetaName(fieldLocator), &postings)
+	if os.IsNotExist(err) {
+		return nil, ErrIndexDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return postings, nil
+}
+
+// rangeEntry is one row of a sorted range index: Value is the field's value
+// encoded so that lexicographic order matches the field's natural order
+// (see sortableEncode), Key is the document it belongs to.
+type rangeEntry struct {
+	Value string
+	Key   string
+}
+
+func loadRangePostings(cl *Collection, fieldLocator string) ([]rangeEntry, error) {
+	var entries []rangeEntry
+	err := cl.store.GetMeta(cl.Name, indexMetaName(fieldLocator), &entries)
+	if os.IsNotExist(err) {
+		return nil, ErrIndexDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// sortableEncodeBias shifts a number into the non-negative range before
+// sortableEncode zero-pads it, so the zero-padded string for a negative
+// number still sorts before that of a larger (less negative, or positive)
+// one - plain %020.6f on a signed float does not: the '-' sign digit aside,
+// "-000000000100.000000" sorts *after* "-000000000005.000000" because the
+// magnitude is compared the same way regardless of sign. Supports field
+// values in [-1e12, 9e12).
+const sortableEncodeBias = 1e12
+
+// sortableEncode renders v so that two values' encodings sort in the same
+// order as the values themselves: numbers are bias-shifted and zero-padded,
+// everything else is compared as-is.
+func sortableEncode(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		return fmt.Sprintf("%020.6f", n+sortableEncodeBias)
+	case string:
+		return n
+	default:
+		return fmt.Sprintf("%v", n)
+	}
+}
+
+// documentFieldValue extracts fieldLocator (a dot-separated path, e.g.
+// "author.name") out of a document's bytes, which are expected to be JSON -
+// the same assumption SetStruct's callers already make when they want that
+// document to be searchable.
+func documentFieldValue(doc []byte) (func(fieldLocator string) (interface{}, bool), error) {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(doc, &parsed); err != nil {
+		return nil, err
+	}
+	return func(fieldLocator string) (interface{}, bool) {
+		cur := interface{}(parsed)
+		for _, part := range strings.Split(fieldLocator, ".") {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			cur, ok = m[part]
+			if !ok {
+				return nil, false
+			}
+		}
+		return cur, true
+	}, nil
+}
+
+/********************************************************************************
+* S E A R C H   R E S U L T
+*********************************************************************************/
+
+// SearchResult streams matching documents one at a time instead of
+// materializing the whole match set, so large result sets don't have to fit
+// in memory at once.
+type SearchResult struct {
+	cl   *Collection
+	keys []string
+	pos  int
+}
+
+// Next advances to the next match and returns its key and document bytes.
+// Once exhausted it returns a nil error and an empty key - callers should
+// stop iterating when key == "".
+func (r *SearchResult) Next() (string, []byte, error) {
+	if r.pos >= len(r.keys) {
+		return "", nil, nil
+	}
+	key := r.keys[r.pos]
+	r.pos++
+
+	doc, err := r.cl.getFileData(key)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, doc, nil
+}
+
+func (r *SearchResult) Close() error {
+	r.pos = len(r.keys)
+	return nil
+}
+
+/********************************************************************************
+* C O L L E C T I O N   S E A R C H   /   I N D E X I N G
+*********************************************************************************/
+
+func (cl *Collection) search(query string) (*SearchResult, error) {
+	node, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := node.eval(cl)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(matched))
+	for k := range matched {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return &SearchResult{cl: cl, keys: keys}, nil
+}
+
+// addIndex builds (or rebuilds) a term index for fieldLocator by walking
+// every document currently in the collection - so AddIndex works whether
+// it's called before or after documents have been written.
+func (cl *Collection) addIndex(fieldLocator string) error {
+	return cl.buildIndex(fieldLocator, false)
+}
+
+// addRangeIndex is identical to addIndex but stores postings sorted by
+// value, so rangeNode.eval doesn't have to scan an index's full key space
+// more than once per lookup.
+func (cl *Collection) addRangeIndex(fieldLocator string) error {
+	return cl.buildIndex(fieldLocator, true)
+}
+
+// withIndexLock serializes every read-modify-write of this collection's
+// postings: indexMu against concurrent goroutines in this process, and -
+// when CrossProcess is enabled - the same on-disk flock that guards ordinary
+// document writes, so a concurrent process can't interleave with a rebuild
+// or an incremental update and corrupt the postings file.
+func (cl *Collection) withIndexLock(fn func() error) error {
+	cl.indexMu.Lock()
+	defer cl.indexMu.Unlock()
+
+	if cl.flock != nil {
+		if err := cl.flock.Lock(); err != nil {
+			return err
+		}
+		defer cl.flock.Unlock()
+	}
+	return fn()
+}
+
+func (cl *Collection) buildIndex(fieldLocator string, isRange bool) error {
+	return cl.withIndexLock(func() error {
+		keys, err := cl.store.List(cl.Name)
+		if err != nil {
+			return err
+		}
+
+		postings := make(map[string][]string)
+		var entries []rangeEntry
+
+		for _, key := range keys {
+			// Bypass cl.get/cl.getFileData: withIndexLock already holds
+			// cl.flock exclusively (and indexMu) for this whole rebuild,
+			// and cl.get's own flock.RLock/Unlock operate on the same
+			// open file description - flock(2) re-locks there are a
+			// conversion/release, not a nest, so that call would silently
+			// downgrade-then-drop the outer exclusive lock after the
+			// very first key. readRawLocked reads without touching
+			// locker/flock at all, same as put relies on it for.
+			doc, err := cl.readRawLocked(key)
+			if err != nil {
+				return err
+			}
+			value, ok := lookupField(doc, fieldLocator)
+			if !ok {
+				continue
+			}
+
+			if isRange {
+				entries = append(entries, rangeEntry{Value: sortableEncode(value), Key: key})
+			} else {
+				strValue := fmt.Sprintf("%v", value)
+				postings[strValue] = append(postings[strValue], key)
+			}
+		}
+
+		if cl.IndexStore.Store == nil {
+			cl.IndexStore.Store = make(map[string]IndexInfo)
+		}
+		cl.IndexStore.Store[fieldLocator] = IndexInfo{FieldLocator: fieldLocator, Range: isRange}
+		if err := cl.store.PutMeta(cl.Name, "index_store.gob", cl.IndexStore.Store); err != nil {
+			return err
+		}
+
+		if isRange {
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Value < entries[j].Value })
+			return cl.store.PutMeta(cl.Name, indexMetaName(fieldLocator), entries)
+		}
+		return cl.store.PutMeta(cl.Name, indexMetaName(fieldLocator), postings)
+	})
+}
+
+// lookupField extracts fieldLocator out of doc, reporting false if doc is
+// nil (no previous/new document to look at), isn't JSON, or doesn't have
+// that field.
+func lookupField(doc []byte, fieldLocator string) (interface{}, bool) {
+	if doc == nil {
+		return nil, false
+	}
+	lookup, err := documentFieldValue(doc)
+	if err != nil {
+		return nil, false
+	}
+	return lookup(fieldLocator)
+}
+
+// updateIndexesForKey keeps every index registered on cl in sync with a
+// single document write, so Search never goes stale between AddIndex calls:
+// for each indexed field it retracts key from whatever value oldData
+// matched (nil if key didn't exist before) and adds it under whatever value
+// newData matches now. Caller (put) must already hold cl.indexMu and
+// cl.flock, so this doesn't take them itself - indexMu is a sync.Mutex, so
+// locking it again here would deadlock against put's own hold of it.
+func (cl *Collection) updateIndexesForKey(key string, oldData, newData []byte) error {
+	for fieldLocator, info := range cl.IndexStore.Store {
+		if err := cl.updateIndexForKeyLocked(fieldLocator, info.Range, key, oldData, newData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateIndexForKeyLocked applies one field's share of updateIndexesForKey.
+// Caller must already hold cl.indexMu (and cl.flock, if any).
+func (cl *Collection) updateIndexForKeyLocked(fieldLocator string, isRange bool, key string, oldData, newData []byte) error {
+	oldValue, hadOld := lookupField(oldData, fieldLocator)
+	newValue, hasNew := lookupField(newData, fieldLocator)
+	if !hadOld && !hasNew {
+		return nil
+	}
+
+	if isRange {
+		entries, err := loadRangePostings(cl, fieldLocator)
+		if err != nil && err != ErrIndexDoesNotExist {
+			return err
+		}
+		if hadOld {
+			entries = removeRangeEntry(entries, key)
+		}
+		if hasNew {
+			entries = append(entries, rangeEntry{Value: sortableEncode(newValue), Key: key})
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Value < entries[j].Value })
+		}
+		return cl.store.PutMeta(cl.Name, indexMetaName(fieldLocator), entries)
+	}
+
+	postings, err := loadPostings(cl, fieldLocator)
+	if err != nil && err != ErrIndexDoesNotExist {
+		return err
+	}
+	if postings == nil {
+		postings = make(map[string][]string)
+	}
+	if hadOld {
+		oldStr := fmt.Sprintf("%v", oldValue)
+		postings[oldStr] = removeString(postings[oldStr], key)
+		if len(postings[oldStr]) == 0 {
+			delete(postings, oldStr)
+		}
+	}
+	if hasNew {
+		newStr := fmt.Sprintf("%v", newValue)
+		postings[newStr] = appendUnique(postings[newStr], key)
+	}
+	return cl.store.PutMeta(cl.Name, indexMetaName(fieldLocator), postings)
+}
+
+func removeRangeEntry(entries []rangeEntry, key string) []rangeEntry {
+	out := entries[:0]
+	for _, e := range entries {
+		if e.Key != key {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func removeString(list []string, s string) []string {
+	out := list[:0]
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,125 @@
+package gofiledb
+
+import (
+	"testing"
+)
+
+func collectKeys(t *testing.T, res *SearchResult) []string {
+	t.Helper()
+	defer res.Close()
+
+	var keys []string
+	for {
+		key, _, err := res.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key == "" {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func newScoreCollection(t *testing.T) *Client {
+	t.Helper()
+	c := newTestClient(t, newTestClientParams(t, false))
+	if err := c.AddCollection(CollectionProps{Name: "scores"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddRangeIndex("scores", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddIndex("scores", "tag"); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := map[string]map[string]interface{}{
+		"neg100":  {"value": -100, "tag": "cold"},
+		"neg5":    {"value": -5, "tag": "cold"},
+		"zero":    {"value": 0, "tag": "mid"},
+		"five":    {"value": 5, "tag": "warm"},
+		"hundred": {"value": 100, "tag": "warm"},
+	}
+	for key, doc := range docs {
+		if err := c.Set("scores", key, mustMarshal(t, doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// TestRangeIndexNegativeValues exercises AddRangeIndex/Search across values
+// that straddle zero. sortableEncode used to zero-pad signed floats directly,
+// under which -100's encoding sorted after -5's (the zero-padded magnitude
+// compares the same regardless of the leading '-'), so >=/<=/>/< queries over
+// a field with negative values returned the wrong documents.
+func TestRangeIndexNegativeValues(t *testing.T) {
+	c := newScoreCollection(t)
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"value:>=-5", []string{"five", "hundred", "neg5", "zero"}},
+		{"value:>-5", []string{"five", "hundred", "zero"}},
+		{"value:<=-5", []string{"neg100", "neg5"}},
+		{"value:<-5", []string{"neg100"}},
+		{"value:>=-100", []string{"five", "hundred", "neg100", "neg5", "zero"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			res, err := c.Search("scores", tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys := collectKeys(t, res)
+			assertSameKeys(t, keys, tc.want)
+		})
+	}
+}
+
+// TestSearchBooleanQuery exercises the AND/OR/NOT/parens query grammar,
+// which previously had no coverage at all.
+func TestSearchBooleanQuery(t *testing.T) {
+	c := newScoreCollection(t)
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"tag:cold AND value:<=-5", []string{"neg100", "neg5"}},
+		{"tag:cold OR tag:warm", []string{"five", "hundred", "neg100", "neg5"}},
+		{"NOT tag:warm", []string{"neg100", "neg5", "zero"}},
+		{"(tag:cold OR tag:warm) AND NOT value:>=100", []string{"five", "neg100", "neg5"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			res, err := c.Search("scores", tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys := collectKeys(t, res)
+			assertSameKeys(t, keys, tc.want)
+		})
+	}
+}
+
+func assertSameKeys(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got keys %v, want %v", got, want)
+	}
+	gotSet := make(map[string]bool, len(got))
+	for _, k := range got {
+		gotSet[k] = true
+	}
+	for _, k := range want {
+		if !gotSet[k] {
+			t.Fatalf("got keys %v, want %v", got, want)
+		}
+	}
+}
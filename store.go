@@ -0,0 +1,152 @@
+package gofiledb
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Store abstracts the durable medium that a Collection reads and writes
+// through. LocalFSStore is the default, backing each collection with a
+// partitioned directory tree on the local filesystem; other implementations
+// (e.g. CassandraStore) let a Client talk to a remote, shared backend
+// instead without touching any of the Set/Get/SetStruct/AddIndex call sites.
+type Store interface {
+	// Put writes the contents of r as collection+key, overwriting any
+	// existing value.
+	Put(collection, key string, r io.Reader) error
+	// Get opens collection+key for reading. Callers must Close the
+	// returned ReadCloser. Returns an error satisfying os.IsNotExist if
+	// the key has never been written.
+	Get(collection, key string) (io.ReadCloser, error)
+	// Delete removes collection+key. It is not an error to delete a key
+	// that does not exist.
+	Delete(collection, key string) error
+	// DeleteCollection removes every key and meta entry stored under
+	// collection. It is not an error to delete a collection that was
+	// never written to.
+	DeleteCollection(collection string) error
+	// List returns every key currently stored under collection.
+	List(collection string) ([]string, error)
+	// PutMeta persists a gob-encodable value under a collection-scoped
+	// meta name (e.g. the IndexStore, cipher info, WAL checkpoints).
+	PutMeta(collection, metaName string, v interface{}) error
+	// GetMeta decodes the value previously stored with PutMeta into v.
+	GetMeta(collection, metaName string, v interface{}) error
+}
+
+// LocalFSStore is the Store implementation backing a plain documentRoot
+// directory on the local filesystem, partitioned the way Client always has.
+type LocalFSStore struct {
+	documentRoot  string
+	numPartitions int
+}
+
+// NewLocalFSStore builds a LocalFSStore rooted at documentRoot, partitioning
+// each collection's data directory into numPartitions sub-folders.
+func NewLocalFSStore(documentRoot string, numPartitions int) *LocalFSStore {
+	return &LocalFSStore{
+		documentRoot:  documentRoot,
+		numPartitions: numPartitions,
+	}
+}
+
+func (s *LocalFSStore) partitionDirPath(collection, key string) string {
+	partition := DATA_PARTITION_PREFIX + getPartitionHash(key, s.numPartitions)
+	return joinPath(s.documentRoot, DATA_DIR_NAME, collection, DATA_DIR_NAME, partition)
+}
+
+func (s *LocalFSStore) filePath(collection, key string) string {
+	return joinPath(s.partitionDirPath(collection, key), key)
+}
+
+func (s *LocalFSStore) Put(collection, key string, r io.Reader) error {
+	dir := s.partitionDirPath(collection, key)
+	if err := createDirIfNotExist(dir); err != nil {
+		return err
+	}
+	file, err := os.Create(s.filePath(collection, key))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, r)
+	return err
+}
+
+func (s *LocalFSStore) Get(collection, key string) (io.ReadCloser, error) {
+	return os.Open(s.filePath(collection, key))
+}
+
+func (s *LocalFSStore) Delete(collection, key string) error {
+	err := os.Remove(s.filePath(collection, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalFSStore) DeleteCollection(collection string) error {
+	err := os.RemoveAll(joinPath(s.documentRoot, DATA_DIR_NAME, collection))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalFSStore) List(collection string) ([]string, error) {
+	var keys []string
+	collectionDataDir := joinPath(s.documentRoot, DATA_DIR_NAME, collection, DATA_DIR_NAME)
+	for i := 0; i < s.numPartitions; i++ {
+		partitionDir := joinPath(collectionDataDir, fmt.Sprintf("%s%d", DATA_PARTITION_PREFIX, i))
+		entries, err := os.ReadDir(partitionDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				keys = append(keys, entry.Name())
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (s *LocalFSStore) metaDirPath(collection string) string {
+	if collection == "" {
+		return joinPath(s.documentRoot, META_DIR_NAME)
+	}
+	return joinPath(s.documentRoot, DATA_DIR_NAME, collection, META_DIR_NAME)
+}
+
+func (s *LocalFSStore) metaFilePath(collection, metaName string) string {
+	return joinPath(s.metaDirPath(collection), metaName)
+}
+
+func (s *LocalFSStore) PutMeta(collection, metaName string, v interface{}) error {
+	filePath := s.metaFilePath(collection, metaName)
+	if err := createDirIfNotExist(parentDirPath(filePath)); err != nil {
+		return err
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return gobEncode(file, v)
+}
+
+func (s *LocalFSStore) GetMeta(collection, metaName string, v interface{}) error {
+	file, err := os.Open(s.metaFilePath(collection, metaName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return gobDecode(file, v)
+}
@@ -0,0 +1,123 @@
+package gofiledb
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/gocql/gocql"
+)
+
+// CassandraStore is a Store backed by Cassandra, for deployments where
+// multiple processes (or hosts) need to share one gofiledb namespace instead
+// of a single local documentRoot. Like SeaweedFS's flat-namespace stores, it
+// keeps no directory hierarchy: every document is addressed directly by
+// collection+key.
+//
+// It expects two tables to already exist in keyspace:
+//
+//	CREATE TABLE gofiledb_blobs (collection text, key text, data blob, PRIMARY KEY (collection, key));
+//	CREATE TABLE gofiledb_meta  (collection text, meta_name text, data blob, PRIMARY KEY (collection, meta_name));
+//
+// Global (client-wide) meta is stored under the empty-string collection.
+type CassandraStore struct {
+	session  *gocql.Session
+	keyspace string
+}
+
+// NewCassandraStore connects to the given Cassandra hosts and returns a
+// Store that reads/writes through the gofiledb_blobs/gofiledb_meta tables in
+// keyspace.
+func NewCassandraStore(keyspace string, hosts ...string) (*CassandraStore, error) {
+	cluster := gocql.NewCluster(hosts...)
+	cluster.Keyspace = keyspace
+	cluster.Consistency = gocql.Quorum
+
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return &CassandraStore{session: session, keyspace: keyspace}, nil
+}
+
+func (s *CassandraStore) Put(collection, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return s.session.Query(
+		`INSERT INTO gofiledb_blobs (collection, key, data) VALUES (?, ?, ?)`,
+		collection, key, data,
+	).Exec()
+}
+
+func (s *CassandraStore) Get(collection, key string) (io.ReadCloser, error) {
+	var data []byte
+	err := s.session.Query(
+		`SELECT data FROM gofiledb_blobs WHERE collection = ? AND key = ?`,
+		collection, key,
+	).Scan(&data)
+	if err == gocql.ErrNotFound {
+		return nil, &fs.PathError{Op: "get", Path: collection + "/" + key, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *CassandraStore) Delete(collection, key string) error {
+	return s.session.Query(
+		`DELETE FROM gofiledb_blobs WHERE collection = ? AND key = ?`,
+		collection, key,
+	).Exec()
+}
+
+func (s *CassandraStore) DeleteCollection(collection string) error {
+	if err := s.session.Query(`DELETE FROM gofiledb_blobs WHERE collection = ?`, collection).Exec(); err != nil {
+		return err
+	}
+	return s.session.Query(`DELETE FROM gofiledb_meta WHERE collection = ?`, collection).Exec()
+}
+
+func (s *CassandraStore) List(collection string) ([]string, error) {
+	var keys []string
+	var key string
+
+	iter := s.session.Query(
+		`SELECT key FROM gofiledb_blobs WHERE collection = ?`,
+		collection,
+	).Iter()
+	for iter.Scan(&key) {
+		keys = append(keys, key)
+	}
+	return keys, iter.Close()
+}
+
+func (s *CassandraStore) PutMeta(collection, metaName string, v interface{}) error {
+	var buf bytes.Buffer
+	if err := gobEncode(&buf, v); err != nil {
+		return err
+	}
+	return s.session.Query(
+		`INSERT INTO gofiledb_meta (collection, meta_name, data) VALUES (?, ?, ?)`,
+		collection, metaName, buf.Bytes(),
+	).Exec()
+}
+
+func (s *CassandraStore) GetMeta(collection, metaName string, v interface{}) error {
+	var data []byte
+	err := s.session.Query(
+		`SELECT data FROM gofiledb_meta WHERE collection = ? AND meta_name = ?`,
+		collection, metaName,
+	).Scan(&data)
+	if err == gocql.ErrNotFound {
+		return &fs.PathError{Op: "get", Path: collection + "/" + metaName, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return err
+	}
+	return gobDecode(bytes.NewReader(data), v)
+}
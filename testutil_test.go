@@ -0,0 +1,44 @@
+package gofiledb
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestClientParams returns ClientParams rooted at a fresh temp directory,
+// pre-creating the "gofiledb_warehouse" subdirectory validate() expects to
+// already exist.
+func newTestClientParams(t *testing.T, primary bool) ClientParams {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "gofiledb_warehouse"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	params := NewClientParams(dir, 2)
+	params.Primary = primary
+	return params
+}
+
+// newTestClient builds a Client from params and registers its Close with
+// t.Cleanup, so the test doesn't leak cdc's flush loop (and the WAL's GC
+// loop, when replication is enabled) past the end of the test.
+func newTestClient(t *testing.T, params ClientParams) *Client {
+	t.Helper()
+	c, err := New(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
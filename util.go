@@ -0,0 +1,64 @@
+package gofiledb
+
+import (
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// joinPath joins path elements using the OS path separator, mirroring the
+// convention already used by Client.getDirPathForCollection
+func joinPath(elem ...string) string {
+	return strings.Join(elem, string(os.PathSeparator))
+}
+
+// createDirIfNotExist creates dirPath (and any parents) if it does not
+// already exist
+func createDirIfNotExist(dirPath string) error {
+	_, err := os.Stat(dirPath)
+	if os.IsNotExist(err) {
+		return os.MkdirAll(dirPath, 0755)
+	}
+	return err
+}
+
+// parentDirPath returns everything before the final path separator in path,
+// so callers can createDirIfNotExist a file's directory without caring
+// whether its name itself contains separators (e.g. "index/some_field")
+func parentDirPath(path string) string {
+	i := strings.LastIndex(path, string(os.PathSeparator))
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// getPartitionHash deterministically maps key to one of numPartitions
+// partition buckets
+func getPartitionHash(key string, numPartitions int) string {
+	h := sha1.Sum([]byte(key))
+	n := new(big.Int).SetBytes(h[:])
+	idx := new(big.Int).Mod(n, big.NewInt(int64(numPartitions)))
+	return fmt.Sprintf("%d", idx.Int64())
+}
+
+// hexEncode is a small helper used by callers that need a filesystem safe
+// representation of raw bytes (e.g. WAL payload hashes)
+func hexEncode(b []byte) string {
+	return hex.EncodeToString(b)
+}
+
+// gobEncode and gobDecode centralize the gob (de)serialization used for all
+// meta structs, so every Store implementation speaks the same wire format
+func gobEncode(w io.Writer, v interface{}) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+func gobDecode(r io.Reader, v interface{}) error {
+	return gob.NewDecoder(r).Decode(v)
+}
@@ -0,0 +1,373 @@
+package gofiledb
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// walOp identifies which mutating Client call produced a walRecord
+type walOp string
+
+const (
+	walOpAddCollection    walOp = "add_collection"
+	walOpRemoveCollection walOp = "remove_collection"
+	walOpSet              walOp = "set"
+	walOpSetStruct        walOp = "set_struct"
+	walOpSetFromReader    walOp = "set_from_reader"
+	walOpAddIndex         walOp = "add_index"
+	walOpAddRangeIndex    walOp = "add_range_index"
+)
+
+// walRecord is one entry in the write-ahead log. LSN is monotonically
+// increasing across the whole Client, never per collection, so secondaries
+// can apply records from every collection in a single total order.
+type walRecord struct {
+	LSN         uint64
+	Op          walOp
+	Collection  string
+	Key         string
+	Payload     []byte
+	PayloadHash string
+	Timestamp   time.Time
+}
+
+func hashPayload(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hexEncode(sum[:])
+}
+
+const (
+	defaultWALSegMinCount  = 1024
+	defaultWALSegMaxAgeSec = 60 * 60
+	defaultWALSegGCAgeSec  = 7 * 24 * 60 * 60
+
+	// walGCInterval is how often gcLoop sweeps sealed segments older than
+	// segGCAge. It isn't exposed as a ClientParams knob - segGCAge already
+	// controls how aggressively old segments are reclaimed, this just
+	// needs to be frequent enough that segGCAge is actually honored.
+	walGCInterval = 10 * time.Minute
+)
+
+// walCheckpointMetaName is the global meta entry Client.saveCheckpoint /
+// loadCheckpoint use to track the LSN up to which the WAL is known to be
+// fully applied to the Store, so New() knows where crash recovery should
+// resume replaying from.
+const walCheckpointMetaName = "wal_checkpoint.gob"
+
+// walWriter owns the append-only WAL segments under documentRoot/wal/ and
+// hands out the next LSN. It is only created when replication is enabled
+// (Client.Primary, or a non-empty PrimaryEndpoint for a secondary following
+// along).
+type walWriter struct {
+	dir         string
+	segMinCount int
+	segMaxAge   time.Duration
+	segGCAge    time.Duration
+	stop        chan struct{} // closed by Close to stop gcLoop
+	done        chan struct{} // closed by gcLoop once it has returned
+
+	mu        sync.Mutex
+	lastLSN   uint64
+	seg       *os.File
+	segEnc    func(v interface{}) error
+	segCount  int
+	segOpened time.Time
+	segName   string
+}
+
+func newWALWriter(documentRoot string, minCount, maxAgeSec, gcAgeSec int) (*walWriter, error) {
+	if minCount <= 0 {
+		minCount = defaultWALSegMinCount
+	}
+	if maxAgeSec <= 0 {
+		maxAgeSec = defaultWALSegMaxAgeSec
+	}
+	if gcAgeSec <= 0 {
+		gcAgeSec = defaultWALSegGCAgeSec
+	}
+
+	dir := joinPath(documentRoot, "wal")
+	if err := createDirIfNotExist(dir); err != nil {
+		return nil, err
+	}
+
+	w := &walWriter{
+		dir:         dir,
+		segMinCount: minCount,
+		segMaxAge:   time.Duration(maxAgeSec) * time.Second,
+		segGCAge:    time.Duration(gcAgeSec) * time.Second,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	lastLSN, err := recoverLastLSN(dir)
+	if err != nil {
+		return nil, err
+	}
+	w.lastLSN = lastLSN
+
+	go w.gcLoop()
+	return w, nil
+}
+
+// gcLoop periodically sweeps sealed segments older than segGCAge, in the
+// spirit of cdcBuffer.flushLoop, so WALSegGCAgeSec is actually honored
+// instead of segments accumulating forever, until Close stops it.
+func (w *walWriter) gcLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(walGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.gc(); err != nil {
+				clog.Errorf("wal: failed to gc segments: %v", err)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Close stops gcLoop and waits for it to actually return. It does not close
+// the currently open segment file - callers are expected to let the process
+// exit do that, the same as before Close existed.
+func (w *walWriter) Close() {
+	close(w.stop)
+	<-w.done
+}
+
+// recoverLastLSN replays every sealed segment's trailing record to find the
+// highest LSN already durable on disk, so a restarted primary never reuses
+// an LSN a secondary may already have applied.
+func recoverLastLSN(dir string) (uint64, error) {
+	segments, err := listWALSegments(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var lastLSN uint64
+	for _, name := range segments {
+		records, err := readWALSegment(joinPath(dir, name))
+		if err != nil {
+			return 0, err
+		}
+		if len(records) > 0 {
+			lastLSN = records[len(records)-1].LSN
+		}
+	}
+	return lastLSN, nil
+}
+
+// listWALSegments returns every segment file name under dir, oldest first.
+func listWALSegments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readWALSegment decodes every record in a single segment file, in the order
+// they were appended. It reuses one gob.Decoder across the whole file rather
+// than one per record: a fresh gob.Decoder buffers ahead from the
+// underlying *os.File, so decoding record N with a new Decoder each time
+// leaves the file's read offset already past records it never actually
+// decoded, silently dropping them.
+func readWALSegment(path string) ([]walRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dec := gob.NewDecoder(file)
+	var records []walRecord
+	for {
+		var rec walRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Append serializes rec (assigning it the next LSN) into the currently open
+// segment, rolling over to a new one first if the current segment is full or
+// stale.
+func (w *walWriter) Append(rec walRecord) (walRecord, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.seg == nil || w.segCount >= w.segMinCount || time.Since(w.segOpened) >= w.segMaxAge {
+		if err := w.rollLocked(); err != nil {
+			return walRecord{}, err
+		}
+	}
+
+	w.lastLSN++
+	rec.LSN = w.lastLSN
+	rec.Timestamp = time.Now()
+	rec.PayloadHash = hashPayload(rec.Payload)
+
+	if err := w.segEnc(rec); err != nil {
+		return walRecord{}, err
+	}
+	w.segCount++
+
+	return rec, nil
+}
+
+// AppendRaw writes rec to the currently open segment exactly as given,
+// preserving its LSN instead of assigning the next one. It's used by a
+// secondary mirroring records pulled from a primary, which must keep the
+// primary's LSNs intact rather than produce its own.
+func (w *walWriter) AppendRaw(rec walRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.seg == nil || w.segCount >= w.segMinCount || time.Since(w.segOpened) >= w.segMaxAge {
+		if err := w.rollLocked(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.segEnc(rec); err != nil {
+		return err
+	}
+	w.segCount++
+	if rec.LSN > w.lastLSN {
+		w.lastLSN = rec.LSN
+	}
+	return nil
+}
+
+func (w *walWriter) rollLocked() error {
+	if w.seg != nil {
+		w.seg.Close()
+	}
+
+	w.segName = fmt.Sprintf("seg-%020d.gob", w.lastLSN+1)
+	file, err := os.Create(joinPath(w.dir, w.segName))
+	if err != nil {
+		return err
+	}
+
+	w.seg = file
+	w.segEnc = newWALEncoder(file)
+	w.segCount = 0
+	w.segOpened = time.Now()
+	return nil
+}
+
+// newWALEncoder returns an append function backed by a single gob.Encoder
+// for the whole segment file, mirroring readWALSegment's single Decoder -
+// a fresh gob.Encoder per record would re-send its type definition every
+// call, which a Decoder reading the file back rejects as a duplicate type
+// once it has already seen it from an earlier record.
+func newWALEncoder(file *os.File) func(v interface{}) error {
+	enc := gob.NewEncoder(file)
+	return func(v interface{}) error {
+		return enc.Encode(v)
+	}
+}
+
+// walCheckpointer tracks which LSNs a Client has durably appended to the WAL
+// but not yet finished applying, so the persisted checkpoint only ever
+// advances to an LSN once every lower LSN has also finished. Without this,
+// two concurrent mutations racing for LSN 2 and LSN 3 could checkpoint at 3
+// the instant LSN 3's apply finishes, even though LSN 2's apply is still in
+// flight - permanently losing LSN 2 if the process crashes right then.
+type walCheckpointer struct {
+	mu         sync.Mutex
+	pending    map[uint64]bool
+	maxStarted uint64
+	persisted  uint64
+}
+
+// newWALCheckpointer seeds the tracker with the checkpoint already on disk,
+// so it never reports a floor lower than what New() already knows is
+// applied.
+func newWALCheckpointer(persisted uint64) *walCheckpointer {
+	return &walCheckpointer{pending: make(map[uint64]bool), maxStarted: persisted, persisted: persisted}
+}
+
+// start records that lsn's WAL record is durable but its mutation may still
+// be mid-flight against the Store.
+func (t *walCheckpointer) start(lsn uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[lsn] = true
+	if lsn > t.maxStarted {
+		t.maxStarted = lsn
+	}
+}
+
+// finish marks lsn's mutation applied and reports the new checkpoint to
+// persist, if the safe floor has advanced. The floor is maxStarted pulled
+// back to one below the lowest LSN still pending, so a slow, lower-LSN'd
+// call finishing after lsn does holds the checkpoint back instead of
+// letting it skip a still-in-flight record.
+func (t *walCheckpointer) finish(lsn uint64) (uint64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, lsn)
+
+	floor := t.maxStarted
+	for pendingLSN := range t.pending {
+		if pendingLSN-1 < floor {
+			floor = pendingLSN - 1
+		}
+	}
+	if floor <= t.persisted {
+		return 0, false
+	}
+	t.persisted = floor
+	return floor, true
+}
+
+// gc removes sealed segments (every segment except the one currently
+// open) older than segGCAge.
+func (w *walWriter) gc() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == w.segName {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) >= w.segGCAge {
+			if err := os.Remove(joinPath(w.dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}